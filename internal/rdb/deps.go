@@ -0,0 +1,217 @@
+package rdb
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// ErrDependencyCycle indicates that EnqueueWithDeps was asked to add a
+// dependency edge that would create a cycle in the task graph.
+var ErrDependencyCycle = errors.New("task dependency graph would contain a cycle")
+
+// Redis keys used by the task dependency graph.
+const (
+	pendingHash   = "asynq:pending"   // HASH - taskID -> TaskMessage json, for tasks awaiting deps
+	depsPrefix    = "asynq:deps:"     // SET  - asynq:deps:<id>, unmet parent IDs for taskID
+	childrenPx    = "asynq:children:" // SET  - asynq:children:<id>, children that depend on taskID
+	completedTask = "asynq:completed" // SET  - IDs of tasks that have finished (Done)
+)
+
+func depsKey(taskID string) string {
+	return depsPrefix + taskID
+}
+
+func childrenKey(taskID string) string {
+	return childrenPx + taskID
+}
+
+// EnqueueWithDeps enqueues msg, but holds it back from any queue
+// until every task ID in parentIDs has completed (i.e. called Done).
+// If parentIDs is empty, or every one of them has already completed,
+// msg is enqueued immediately, same as Enqueue. It returns
+// ErrDependencyCycle if adding this dependency edge would make msg an
+// ancestor of one of its own parents.
+func (r *RDB) EnqueueWithDeps(msg *TaskMessage, parentIDs []string) error {
+	if len(parentIDs) == 0 {
+		return r.Enqueue(msg)
+	}
+	descendants, err := r.descendants(msg.ID)
+	if err != nil {
+		return err
+	}
+	// msg.ID is trivially its own descendant: depending on itself, or
+	// on anything that (transitively) depends on it, is a cycle.
+	descendants[msg.ID] = true
+	for _, pid := range parentIDs {
+		if descendants[pid] {
+			return ErrDependencyCycle
+		}
+	}
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	qname := msg.queueName()
+	// The completed-check and the pending/deps/children bookkeeping
+	// must be atomic: if a parent's Done ran promoteChildren between a
+	// plain SISMEMBER check and registering msg as its child, that
+	// promotion would never see msg and it would be stuck pending
+	// forever. Doing both in one script closes that window.
+	//
+	// KEYS[1] -> completed set
+	// KEYS[2] -> pending hash
+	// KEYS[3] -> queue set
+	// ARGV[1] -> msg.ID
+	// ARGV[2] -> task message value
+	// ARGV[3] -> destination queue name
+	// ARGV[4:] -> parentIDs
+	script := redis.NewScript(`
+	local unmet = {}
+	for i = 4, #ARGV do
+		if redis.call("SISMEMBER", KEYS[1], ARGV[i]) == 0 then
+			table.insert(unmet, ARGV[i])
+		end
+	end
+	redis.call("SADD", KEYS[3], ARGV[3])
+	if #unmet == 0 then
+		redis.call("LPUSH", "asynq:queues:" .. ARGV[3], ARGV[2])
+		return 0
+	end
+	redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+	for _, pid in ipairs(unmet) do
+		redis.call("SADD", "asynq:deps:" .. ARGV[1], pid)
+		redis.call("SADD", "asynq:children:" .. pid, ARGV[1])
+	end
+	return #unmet
+	`)
+	args := make([]interface{}, 0, 3+len(parentIDs))
+	args = append(args, msg.ID, string(bytes), qname)
+	for _, pid := range parentIDs {
+		args = append(args, pid)
+	}
+	_, err = script.Run(r.client, []string{completedTask, pendingHash, queueSet}, args...).Result()
+	return err
+}
+
+// descendants returns the set of task IDs reachable from taskID by
+// following "depends on me" edges forward (i.e. taskID's children,
+// their children, and so on).
+func (r *RDB) descendants(taskID string) (map[string]bool, error) {
+	seen := map[string]bool{}
+	queue := []string{taskID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		children, err := r.client.SMembers(childrenKey(id)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if !seen[child] {
+				seen[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// promoteChildren is called when taskID finishes (Done). It records
+// taskID as completed and, for every child waiting on it, removes
+// taskID from that child's remaining dependencies; any child left
+// with no remaining dependencies is moved from the pending hash into
+// its destination queue. It returns the IDs of the children that were
+// promoted.
+func (r *RDB) promoteChildren(taskID string) ([]string, error) {
+	// KEYS[1] -> children set for taskID
+	// KEYS[2] -> pending hash
+	// KEYS[3] -> completed set
+	// ARGV[1] -> taskID
+	// ARGV[2] -> queue set key (asynq:queues)
+	script := redis.NewScript(`
+	redis.call("SADD", KEYS[3], ARGV[1])
+	local children = redis.call("SMEMBERS", KEYS[1])
+	local promoted = {}
+	for _, child in ipairs(children) do
+		local depsKey = "asynq:deps:" .. child
+		redis.call("SREM", depsKey, ARGV[1])
+		if redis.call("SCARD", depsKey) == 0 then
+			local data = redis.call("HGET", KEYS[2], child)
+			if data then
+				redis.call("HDEL", KEYS[2], child)
+				redis.call("DEL", depsKey)
+				local msg = cjson.decode(data)
+				local qname = msg["Queue"]
+				if qname == nil or qname == "" then
+					qname = "default"
+				end
+				redis.call("LPUSH", "asynq:queues:" .. qname, data)
+				redis.call("SADD", ARGV[2], qname)
+				table.insert(promoted, child)
+			end
+		end
+	end
+	redis.call("DEL", KEYS[1])
+	return promoted
+	`)
+	res, err := script.Run(r.client,
+		[]string{childrenKey(taskID), pendingHash, completedTask},
+		taskID, queueSet).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := res.([]interface{})
+	promoted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if s, ok := id.(string); ok {
+			promoted = append(promoted, s)
+		}
+	}
+	return promoted, nil
+}
+
+// Cancel removes taskID and all of its not-yet-ready descendants from
+// the dependency graph, so none of them will ever be enqueued. It
+// returns the number of tasks removed this way. Cancel has no effect
+// on a task that has already been promoted to a queue.
+//
+// The descendant walk and the pending/deps/children cleanup all run
+// inside a single script, for the same reason EnqueueWithDeps's
+// completed-check and registration do: without that, a concurrent
+// Done on one of these tasks' parents could race promoteChildren's
+// HGET/HDEL of the pending hash against Cancel's own HDEL of the same
+// key, letting a task get promoted to a live queue and cancelled at
+// the same time.
+func (r *RDB) Cancel(taskID string) (int64, error) {
+	script := redis.NewScript(`
+	local visited = {}
+	local queue = {ARGV[1]}
+	local head = 1
+	while head <= #queue do
+		local id = queue[head]
+		head = head + 1
+		if not visited[id] then
+			visited[id] = true
+			local children = redis.call("SMEMBERS", "asynq:children:" .. id)
+			for _, child in ipairs(children) do
+				table.insert(queue, child)
+			end
+		end
+	end
+	local cancelled = 0
+	for id, _ in pairs(visited) do
+		cancelled = cancelled + redis.call("HDEL", "asynq:pending", id)
+		redis.call("DEL", "asynq:deps:" .. id)
+		redis.call("DEL", "asynq:children:" .. id)
+	end
+	return cancelled
+	`)
+	res, err := script.Run(r.client, nil, taskID).Result()
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.(int64)
+	return n, nil
+}
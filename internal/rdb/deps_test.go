@@ -0,0 +1,217 @@
+package rdb
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnqueueWithDepsDiamond(t *testing.T) {
+	r := setup(t)
+
+	// root -> {left, right} -> sink, a classic diamond.
+	root := newTaskMessage("root", nil)
+	left := newTaskMessage("left", nil)
+	right := newTaskMessage("right", nil)
+	sink := newTaskMessage("sink", nil)
+
+	if err := r.EnqueueWithDeps(root, nil); err != nil {
+		t.Fatalf("EnqueueWithDeps(root) = %v, want nil", err)
+	}
+	if err := r.EnqueueWithDeps(left, []string{root.ID}); err != nil {
+		t.Fatalf("EnqueueWithDeps(left) = %v, want nil", err)
+	}
+	if err := r.EnqueueWithDeps(right, []string{root.ID}); err != nil {
+		t.Fatalf("EnqueueWithDeps(right) = %v, want nil", err)
+	}
+	if err := r.EnqueueWithDeps(sink, []string{left.ID, right.ID}); err != nil {
+		t.Fatalf("EnqueueWithDeps(sink) = %v, want nil", err)
+	}
+
+	if l := r.client.LLen(defaultQ).Val(); l != 1 {
+		t.Fatalf("%q has length %d, want 1 (only root ready)", defaultQ, l)
+	}
+
+	got, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue(root) = %v, want nil", err)
+	}
+	if err := r.Done(got); err != nil {
+		t.Fatalf("Done(root) = %v, want nil", err)
+	}
+
+	if l := r.client.LLen(defaultQ).Val(); l != 2 {
+		t.Fatalf("%q has length %d, want 2 (left and right ready)", defaultQ, l)
+	}
+	if l := r.client.HLen(pendingHash).Val(); l != 1 {
+		t.Errorf("%q has length %d, want 1 (only sink still pending)", pendingHash, l)
+	}
+
+	leftDone, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue(left) = %v, want nil", err)
+	}
+	if err := r.Done(leftDone); err != nil {
+		t.Fatalf("Done(left) = %v, want nil", err)
+	}
+	if l := r.client.HLen(pendingHash).Val(); l != 1 {
+		t.Errorf("%q has length %d, want 1 (sink still waiting on the other side)", pendingHash, l)
+	}
+
+	rightDone, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue(right) = %v, want nil", err)
+	}
+	if err := r.Done(rightDone); err != nil {
+		t.Fatalf("Done(right) = %v, want nil", err)
+	}
+
+	if l := r.client.HLen(pendingHash).Val(); l != 0 {
+		t.Errorf("%q has length %d, want 0 (sink promoted)", pendingHash, l)
+	}
+	sinkDone, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue(sink) = %v, want nil", err)
+	}
+	if sinkDone.ID != sink.ID {
+		t.Errorf("dequeued task ID = %q, want %q", sinkDone.ID, sink.ID)
+	}
+}
+
+func TestEnqueueWithDepsCycleRejected(t *testing.T) {
+	r := setup(t)
+
+	a := newTaskMessage("a", nil)
+	b := newTaskMessage("b", nil)
+
+	if err := r.EnqueueWithDeps(a, nil); err != nil {
+		t.Fatalf("EnqueueWithDeps(a) = %v, want nil", err)
+	}
+	if err := r.EnqueueWithDeps(b, []string{a.ID}); err != nil {
+		t.Fatalf("EnqueueWithDeps(b) = %v, want nil", err)
+	}
+
+	// a already depends (transitively, via b) on nothing yet, but if we
+	// now tried to make a depend on b, we'd close a cycle: a -> b -> a.
+	// Since a is already enqueued, we reuse its ID to construct that
+	// scenario through a fresh message with the same ID relationship.
+	cyclic := &TaskMessage{ID: a.ID, Type: "a", Queue: "default", Retry: 25}
+	if err := r.EnqueueWithDeps(cyclic, []string{b.ID}); err != ErrDependencyCycle {
+		t.Errorf("EnqueueWithDeps(cyclic) = %v, want %v", err, ErrDependencyCycle)
+	}
+}
+
+func TestEnqueueWithDepsSelfCycleRejected(t *testing.T) {
+	r := setup(t)
+
+	msg := newTaskMessage("self", nil)
+	if err := r.EnqueueWithDeps(msg, []string{msg.ID}); err != ErrDependencyCycle {
+		t.Errorf("EnqueueWithDeps(self-dependent) = %v, want %v", err, ErrDependencyCycle)
+	}
+	if l := r.client.HLen(pendingHash).Val(); l != 0 {
+		t.Errorf("%q has length %d, want 0 (rejected task must not be stored)", pendingHash, l)
+	}
+}
+
+func TestCancelCascades(t *testing.T) {
+	r := setup(t)
+
+	root := newTaskMessage("root", nil)
+	child := newTaskMessage("child", nil)
+	grandchild := newTaskMessage("grandchild", nil)
+
+	if err := r.EnqueueWithDeps(root, nil); err != nil {
+		t.Fatalf("EnqueueWithDeps(root) = %v, want nil", err)
+	}
+	if err := r.EnqueueWithDeps(child, []string{root.ID}); err != nil {
+		t.Fatalf("EnqueueWithDeps(child) = %v, want nil", err)
+	}
+	if err := r.EnqueueWithDeps(grandchild, []string{child.ID}); err != nil {
+		t.Fatalf("EnqueueWithDeps(grandchild) = %v, want nil", err)
+	}
+
+	n, err := r.Cancel(child.ID)
+	if err != nil {
+		t.Fatalf("Cancel(child) = %v, want nil", err)
+	}
+	if n != 2 {
+		t.Errorf("Cancel(child) cancelled %d tasks, want 2 (child and grandchild)", n)
+	}
+	if l := r.client.HLen(pendingHash).Val(); l != 0 {
+		t.Errorf("%q has length %d, want 0", pendingHash, l)
+	}
+
+	got, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue(root) = %v, want nil", err)
+	}
+	if err := r.Done(got); err != nil {
+		t.Fatalf("Done(root) = %v, want nil", err)
+	}
+	// child was cancelled, so finishing root must not resurrect it.
+	if _, err := r.Dequeue(2 * time.Second); err != ErrDequeueTimeout {
+		t.Errorf("Dequeue after cancel+Done = %v, want %v", err, ErrDequeueTimeout)
+	}
+}
+
+// TestCancelRacesDone fires Cancel(child) concurrently with Done(root)
+// (which promotes child via promoteChildren) across many trials, and
+// checks that the two never both "win": child ends up either fully
+// cancelled (never queued) or fully promoted (queued exactly once),
+// and never left stuck in the pending hash either way.
+func TestCancelRacesDone(t *testing.T) {
+	r := setup(t)
+
+	const trials = 20
+	for i := 0; i < trials; i++ {
+		flushDB(t, r)
+
+		root := newTaskMessage("root", nil)
+		child := newTaskMessage("child", nil)
+		if err := r.EnqueueWithDeps(root, nil); err != nil {
+			t.Fatalf("trial %d: EnqueueWithDeps(root) = %v, want nil", i, err)
+		}
+		if err := r.EnqueueWithDeps(child, []string{root.ID}); err != nil {
+			t.Fatalf("trial %d: EnqueueWithDeps(child) = %v, want nil", i, err)
+		}
+		got, err := r.Dequeue(time.Second)
+		if err != nil {
+			t.Fatalf("trial %d: Dequeue(root) = %v, want nil", i, err)
+		}
+
+		var wg sync.WaitGroup
+		var cancelled int64
+		var doneErr, cancelErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			doneErr = r.Done(got)
+		}()
+		go func() {
+			defer wg.Done()
+			cancelled, cancelErr = r.Cancel(child.ID)
+		}()
+		wg.Wait()
+		if doneErr != nil {
+			t.Fatalf("trial %d: Done(root) = %v, want nil", i, doneErr)
+		}
+		if cancelErr != nil {
+			t.Fatalf("trial %d: Cancel(child) = %v, want nil", i, cancelErr)
+		}
+
+		queued := r.client.LLen(defaultQ).Val()
+		pending := r.client.HLen(pendingHash).Val()
+		if pending != 0 {
+			t.Errorf("trial %d: %q has length %d, want 0 either way", i, pendingHash, pending)
+		}
+		if cancelled == 1 {
+			if queued != 0 {
+				t.Errorf("trial %d: Cancel reported child cancelled, but %q has length %d, want 0", i, defaultQ, queued)
+			}
+		} else {
+			if queued != 1 {
+				t.Errorf("trial %d: Cancel reported nothing cancelled, but %q has length %d, want 1 (child promoted)", i, defaultQ, queued)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package rdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReclaimExpiredDeadWorker(t *testing.T) {
+	r := setup(t)
+	msg := newTaskMessage("send_email", nil)
+	seedDefaultQueue(t, r, []*TaskMessage{msg})
+
+	got, err := r.DequeueFromWorker("dead-worker", []string{"default"}, []int{1}, time.Second)
+	if err != nil {
+		t.Fatalf("DequeueFromWorker = %v, want nil", err)
+	}
+	if got.Type != msg.Type {
+		t.Fatalf("dequeued unexpected task: %+v", got)
+	}
+	// Never heartbeat for "dead-worker", simulating a crash right
+	// after dequeuing.
+
+	n, err := r.ReclaimExpired()
+	if err != nil {
+		t.Fatalf("ReclaimExpired = %v, want nil", err)
+	}
+	if n != 1 {
+		t.Errorf("ReclaimExpired reclaimed %d tasks, want 1", n)
+	}
+
+	if l := r.client.LLen(workerInProgressKey("dead-worker")).Val(); l != 0 {
+		t.Errorf("%q has length %d, want 0", workerInProgressKey("dead-worker"), l)
+	}
+	if l := r.client.LLen(defaultQ).Val(); l != 1 {
+		t.Errorf("%q has length %d, want 1", defaultQ, l)
+	}
+}
+
+func TestReclaimExpiredLiveWorker(t *testing.T) {
+	r := setup(t)
+	msg := newTaskMessage("send_email", nil)
+	seedDefaultQueue(t, r, []*TaskMessage{msg})
+
+	if _, err := r.DequeueFromWorker("live-worker", []string{"default"}, []int{1}, time.Second); err != nil {
+		t.Fatalf("DequeueFromWorker = %v, want nil", err)
+	}
+	if err := r.Heartbeat("live-worker", time.Minute); err != nil {
+		t.Fatalf("Heartbeat = %v, want nil", err)
+	}
+
+	n, err := r.ReclaimExpired()
+	if err != nil {
+		t.Fatalf("ReclaimExpired = %v, want nil", err)
+	}
+	if n != 0 {
+		t.Errorf("ReclaimExpired reclaimed %d tasks, want 0", n)
+	}
+
+	if l := r.client.LLen(workerInProgressKey("live-worker")).Val(); l != 1 {
+		t.Errorf("%q has length %d, want 1", workerInProgressKey("live-worker"), l)
+	}
+	if l := r.client.LLen(defaultQ).Val(); l != 0 {
+		t.Errorf("%q has length %d, want 0", defaultQ, l)
+	}
+}
@@ -0,0 +1,77 @@
+package rdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnqueueToAndQueues(t *testing.T) {
+	r := setup(t)
+
+	if err := r.EnqueueTo("critical", newTaskMessage("send_email", nil)); err != nil {
+		t.Fatalf("EnqueueTo(critical) = %v, want nil", err)
+	}
+	if err := r.EnqueueTo("low", newTaskMessage("send_email", nil)); err != nil {
+		t.Fatalf("EnqueueTo(low) = %v, want nil", err)
+	}
+
+	got, err := r.Queues()
+	if err != nil {
+		t.Fatalf("Queues() = %v, want nil", err)
+	}
+	want := map[string]bool{"critical": true, "low": true}
+	if len(got) != len(want) {
+		t.Fatalf("Queues() = %v, want %v", got, want)
+	}
+	for _, qname := range got {
+		if !want[qname] {
+			t.Errorf("Queues() returned unexpected queue %q", qname)
+		}
+	}
+}
+
+// TestDequeueFromWeightedFairness seeds "critical" and "low" with many
+// tasks each and asserts that DequeueFrom both (a) eventually drains
+// every task from both queues, with none starved, and (b) serves the
+// higher-weight queue more often, so that it is ahead by the halfway
+// point.
+func TestDequeueFromWeightedFairness(t *testing.T) {
+	r := setup(t)
+
+	const n = 60
+	for i := 0; i < n; i++ {
+		if err := r.EnqueueTo("critical", newTaskMessage("critical_task", nil)); err != nil {
+			t.Fatalf("EnqueueTo(critical) = %v, want nil", err)
+		}
+		if err := r.EnqueueTo("low", newTaskMessage("low_task", nil)); err != nil {
+			t.Fatalf("EnqueueTo(low) = %v, want nil", err)
+		}
+	}
+
+	qnames := []string{"critical", "low"}
+	weights := []int{9, 1}
+	var criticalSeen, lowSeen int
+	for i := 0; i < 2*n; i++ {
+		got, err := r.DequeueFrom(qnames, weights, time.Second)
+		if err != nil {
+			t.Fatalf("DequeueFrom = %v, want nil", err)
+		}
+		switch got.Type {
+		case "critical_task":
+			criticalSeen++
+		case "low_task":
+			lowSeen++
+		default:
+			t.Fatalf("dequeued unexpected task: %+v", got)
+		}
+		// Weight 9 vs 1 means critical should be drained well before
+		// low is, so by the halfway point it should be clearly ahead.
+		if i == n-1 && criticalSeen <= lowSeen {
+			t.Errorf("after %d draws: critical=%d low=%d, want critical ahead given its 9x weight", i+1, criticalSeen, lowSeen)
+		}
+	}
+
+	if criticalSeen != n || lowSeen != n {
+		t.Errorf("drained %d critical, %d low tasks, want %d of each (no starvation)", criticalSeen, lowSeen, n)
+	}
+}
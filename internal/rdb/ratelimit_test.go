@@ -0,0 +1,53 @@
+package rdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDequeueRateLimit(t *testing.T) {
+	r := setup(t)
+
+	if err := r.SetRateLimit("send_email", 5, 1); err != nil {
+		t.Fatalf("SetRateLimit = %v, want nil", err)
+	}
+	for i := 0; i < 3; i++ {
+		seedDefaultQueue(t, r, []*TaskMessage{newTaskMessage("send_email", nil)})
+	}
+
+	got, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("first Dequeue = %v, want nil", err)
+	}
+	if got.Type != "send_email" {
+		t.Fatalf("dequeued unexpected task: %+v", got)
+	}
+
+	// The burst of 1 was just spent, so the next two tasks should be
+	// pushed into the scheduled queue instead of being handed back,
+	// and Dequeue should time out waiting for the default queue.
+	if _, err := r.Dequeue(2 * time.Second); err != ErrDequeueTimeout {
+		t.Errorf("second Dequeue = %v, want %v", err, ErrDequeueTimeout)
+	}
+
+	if l := r.client.ZCard(scheduledQ).Val(); l != 2 {
+		t.Errorf("%q has length %d, want 2", scheduledQ, l)
+	}
+	if l := r.client.LLen(defaultQ).Val(); l != 0 {
+		t.Errorf("%q has length %d, want 0", defaultQ, l)
+	}
+}
+
+func TestDequeueUnlimitedTaskType(t *testing.T) {
+	r := setup(t)
+	msg := newTaskMessage("no_limit", nil)
+	seedDefaultQueue(t, r, []*TaskMessage{msg})
+
+	got, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue = %v, want nil", err)
+	}
+	if got.Type != msg.Type {
+		t.Errorf("dequeued unexpected task: %+v", got)
+	}
+}
@@ -0,0 +1,707 @@
+// Package rdb encapsulates the interactions with redis.
+package rdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	// ErrDequeueTimeout indicates that the blocking dequeue operation timed out.
+	ErrDequeueTimeout = errors.New("blocking dequeue operation timed out")
+
+	// ErrTaskNotFound indicates that a task that matches the given identifier was not found.
+	ErrTaskNotFound = errors.New("could not find a task")
+
+	// ErrNoQueues indicates that DequeueFrom was called without any queue to poll,
+	// or with a number of weights that differs from the number of queues.
+	ErrNoQueues = errors.New("no queues given to dequeue from")
+
+	// ErrDuplicateTask indicates that a task with the same type and
+	// payload is already enqueued or in-progress.
+	ErrDuplicateTask = errors.New("task already exists")
+)
+
+// Redis keys.
+const (
+	queuePrefix = "asynq:queues:" // LIST - asynq:queues:<qname>
+	queueSet    = "asynq:queues"  // SET  - set of known queue names
+	defaultQ    = queuePrefix + "default"
+	inProgressQ = "asynq:in_progress" // LIST
+	scheduledQ  = "asynq:scheduled"   // ZSET
+	retryQ      = "asynq:retry"       // ZSET
+	deadQ       = "asynq:dead"        // ZSET
+)
+
+// queueKey returns the redis key for the queue with the given name.
+func queueKey(qname string) string {
+	return queuePrefix + qname
+}
+
+// Redis keys used to track per-worker liveness and in-progress tasks.
+const (
+	workerSet         = "asynq:workers"     // SET  - IDs of workers seen via Heartbeat
+	workerHeartbeatPx = "asynq:worker:"     // STRING (with TTL) - asynq:worker:<id>
+	workerInProgressP = "asynq:inprogress:" // LIST - asynq:inprogress:<id>
+)
+
+// workerHeartbeatKey returns the redis key holding workerID's liveness TTL.
+func workerHeartbeatKey(workerID string) string {
+	return workerHeartbeatPx + workerID
+}
+
+// workerInProgressKey returns the redis key holding the tasks
+// currently being processed by workerID.
+func workerInProgressKey(workerID string) string {
+	return workerInProgressP + workerID
+}
+
+// rateLimitKeyPrefix is the redis key prefix used to hold the token
+// bucket state that backs SetRateLimit.
+const rateLimitKeyPrefix = "asynq:ratelimit:"
+
+// rateLimitKey returns the redis key holding the token bucket for the
+// given task type.
+func rateLimitKey(taskType string) string {
+	return rateLimitKeyPrefix + taskType
+}
+
+// uniqueKeyPrefix is the redis key prefix used to hold the TTL lock
+// that backs EnqueueUnique and ScheduleUnique.
+const uniqueKeyPrefix = "asynq:unique:"
+
+// uniqueKey returns the redis key for the TTL lock that guards against
+// duplicate enqueues of a task with the given type and payload. The
+// key is deterministic so the lock can be located again later (e.g.
+// to release it) without persisting it on the task message itself.
+func uniqueKey(taskType string, payload map[string]interface{}) (string, error) {
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(taskType+":"), bytes...))
+	return uniqueKeyPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// TaskMessage is the internal representation of a task with additional
+// metadata fields. Serialized data of this type gets written to redis.
+type TaskMessage struct {
+	// Type indicates the kind of the task to be performed.
+	Type string
+
+	// Payload holds data needed to process the task.
+	Payload map[string]interface{}
+
+	// ID is a unique identifier for each task.
+	ID string
+
+	// Queue is the name of the queue this message should be enqueued to.
+	// Defaults to "default" when left empty.
+	Queue string
+
+	// Retry is the max number of retry for this task.
+	Retry int
+
+	// Retried is the number of times we've retried this task so far.
+	Retried int
+
+	// ErrorMsg holds the error message from the last failure.
+	ErrorMsg string
+}
+
+// queueName returns the queue name for msg, defaulting to "default"
+// when the message does not specify one.
+func (msg *TaskMessage) queueName() string {
+	if msg.Queue == "" {
+		return "default"
+	}
+	return msg.Queue
+}
+
+// RDB is a client interface to query and mutate task queues.
+type RDB struct {
+	client *redis.Client
+}
+
+// NewRDB returns a new instance of RDB.
+func NewRDB(client *redis.Client) *RDB {
+	return &RDB{client}
+}
+
+// Close closes the connection with redis server.
+func (r *RDB) Close() error {
+	return r.client.Close()
+}
+
+// registerQueue records qname in the set of known queues so that
+// Queues can report it later.
+func (r *RDB) registerQueue(qname string) error {
+	return r.client.SAdd(queueSet, qname).Err()
+}
+
+// Queues returns the names of all queues known to RDB, in no
+// particular order.
+func (r *RDB) Queues() ([]string, error) {
+	return r.client.SMembers(queueSet).Result()
+}
+
+// Enqueue inserts the given task to the tail of the queue named by
+// msg.Queue (or "default" if unspecified).
+func (r *RDB) Enqueue(msg *TaskMessage) error {
+	return r.EnqueueTo(msg.queueName(), msg)
+}
+
+// EnqueueTo inserts the given task to the tail of the queue with the
+// given name, recording the queue as known so that Queues can later
+// report it.
+func (r *RDB) EnqueueTo(qname string, msg *TaskMessage) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := r.registerQueue(qname); err != nil {
+		return err
+	}
+	return r.client.LPush(queueKey(qname), string(bytes)).Err()
+}
+
+// EnqueueUnique inserts the given task to the tail of its queue unless
+// a task with the same type and payload is already enqueued or
+// in-progress, in which case it returns ErrDuplicateTask. The
+// uniqueness lock expires after ttl, after which an identical task
+// may be enqueued again even if this one hasn't finished processing.
+func (r *RDB) EnqueueUnique(msg *TaskMessage, ttl time.Duration) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	lockKey, err := uniqueKey(msg.Type, msg.Payload)
+	if err != nil {
+		return err
+	}
+	qname := msg.queueName()
+	if err := r.registerQueue(qname); err != nil {
+		return err
+	}
+	// KEYS[1] -> unique lock key
+	// KEYS[2] -> destination queue key
+	// ARGV[1] -> task message value
+	// ARGV[2] -> lock TTL in milliseconds
+	script := redis.NewScript(`
+	local ok = redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+	if not ok then
+		return 0
+	end
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+	return 1
+	`)
+	res, err := script.Run(r.client,
+		[]string{lockKey, queueKey(qname)},
+		string(bytes), ttl.Milliseconds()).Result()
+	if err != nil {
+		return err
+	}
+	if n, ok := res.(int64); ok && n == 0 {
+		return ErrDuplicateTask
+	}
+	return nil
+}
+
+// SetRateLimit caps the rate at which tasks of the given type are
+// handed out by Dequeue/DequeueFrom/DequeueFromWorker to rate tasks
+// per second, with up to burst tasks allowed through in a single
+// instant. Tasks of this type that are dequeued while no token is
+// available are transparently rescheduled instead of being handed to
+// the caller; they become eligible again once a token frees up.
+func (r *RDB) SetRateLimit(taskType string, rate float64, burst int) error {
+	return r.client.HSet(rateLimitKey(taskType), map[string]interface{}{
+		"rate":        rate,
+		"burst":       burst,
+		"tokens":      burst,
+		"last_refill": float64(time.Now().UnixNano()) / 1e9,
+	}).Err()
+}
+
+// takeToken attempts to take one token from taskType's bucket. If
+// taskType has no configured rate limit, it is always allowed. If the
+// bucket is empty, it returns allowed=false along with how long the
+// caller should wait before a token becomes available.
+func (r *RDB) takeToken(taskType string) (allowed bool, retryAfter time.Duration, err error) {
+	// KEYS[1] -> asynq:ratelimit:<type>
+	// ARGV[1] -> current unix time (seconds)
+	script := redis.NewScript(`
+	local rate = tonumber(redis.call("HGET", KEYS[1], "rate"))
+	if not rate then
+		return {1, 0}
+	end
+	local burst = tonumber(redis.call("HGET", KEYS[1], "burst"))
+	local tokens = tonumber(redis.call("HGET", KEYS[1], "tokens"))
+	local lastRefill = tonumber(redis.call("HGET", KEYS[1], "last_refill"))
+	local now = tonumber(ARGV[1])
+	local elapsed = now - lastRefill
+	if elapsed < 0 then
+		elapsed = 0
+	end
+	tokens = math.min(burst, tokens + elapsed * rate)
+	if tokens >= 1 then
+		redis.call("HSET", KEYS[1], "tokens", tokens - 1, "last_refill", now)
+		return {1, "0"}
+	end
+	redis.call("HSET", KEYS[1], "tokens", tokens, "last_refill", now)
+	-- Lua->RESP conversion truncates numbers to integers, so the wait
+	-- is returned as a string to preserve its fractional part.
+	return {0, tostring((1 - tokens) / rate)}
+	`)
+	res, err := script.Run(r.client, []string{rateLimitKey(taskType)}, float64(time.Now().UnixNano())/1e9).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return false, 0, fmt.Errorf("unexpected token bucket result: %v", res)
+	}
+	allowed = vals[0].(int64) == 1
+	waitStr, _ := vals[1].(string)
+	wait, _ := strconv.ParseFloat(waitStr, 64)
+	return allowed, time.Duration(wait * float64(time.Second)), nil
+}
+
+// Dequeue blocks until there is a task available in the default
+// queue, once a task is available, it adds the task to "in progress"
+// queue and returns the task. If there are no tasks for the entire
+// timeout duration, it returns ErrDequeueTimeout.
+func (r *RDB) Dequeue(timeout time.Duration) (*TaskMessage, error) {
+	return r.DequeueFrom([]string{"default"}, []int{1}, timeout)
+}
+
+// DequeueFrom performs a weighted fair poll across the given queues:
+// qnames[i] is polled with weight weights[i], so higher-weight queues
+// are visited more often than lower-weight ones without starving
+// them entirely. Once a task is available, it is moved to the
+// shared "in progress" queue and returned. If no task becomes
+// available before timeout elapses, it returns ErrDequeueTimeout.
+//
+// DequeueFrom is meant for simple, single-process setups; processes
+// that want their in-progress tasks tracked per worker (so a crashed
+// worker's tasks can be reclaimed without disturbing healthy ones)
+// should use DequeueFromWorker instead.
+func (r *RDB) DequeueFrom(qnames []string, weights []int, timeout time.Duration) (*TaskMessage, error) {
+	return r.dequeueFrom(qnames, weights, timeout, inProgressQ)
+}
+
+// DequeueFromWorker is like DequeueFrom, but records the dequeued
+// task in the given worker's own in-progress list instead of the
+// shared one, so that ReclaimExpired can later requeue it without
+// touching tasks belonging to other, healthy workers.
+func (r *RDB) DequeueFromWorker(workerID string, qnames []string, weights []int, timeout time.Duration) (*TaskMessage, error) {
+	if err := r.client.SAdd(workerSet, workerID).Err(); err != nil {
+		return nil, err
+	}
+	return r.dequeueFrom(qnames, weights, timeout, workerInProgressKey(workerID))
+}
+
+func (r *RDB) dequeueFrom(qnames []string, weights []int, timeout time.Duration, destKey string) (*TaskMessage, error) {
+	if len(qnames) == 0 || len(qnames) != len(weights) {
+		return nil, ErrNoQueues
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		order := weightedShuffle(qnames, weights)
+		for _, qname := range order {
+			data, err := r.client.RPopLPush(queueKey(qname), destKey).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			msg, admitted, err := r.admit(destKey, data)
+			if err != nil {
+				return nil, err
+			}
+			if !admitted {
+				continue
+			}
+			return msg, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrDequeueTimeout
+		}
+		// None of the queues had a task ready; block on the first
+		// queue of this round's weighted order for up to a second so we
+		// revisit the weighted order regularly instead of starving the
+		// others.
+		// BRPOPLPUSH only supports whole-second timeouts, so anything
+		// shorter is waited out here instead of passed to redis.
+		if remaining < time.Second {
+			time.Sleep(remaining)
+			continue
+		}
+		data, err := r.client.BRPopLPush(queueKey(order[0]), destKey, time.Second).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg, admitted, err := r.admit(destKey, data)
+		if err != nil || !admitted {
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// admit unmarshals the just-dequeued data and, if its task type is
+// rate limited and out of tokens, moves it from destKey into the
+// scheduled queue to be retried once a token is available again. In
+// that case it returns admitted=false and the caller should keep
+// polling for another task rather than handing this one to a worker.
+func (r *RDB) admit(destKey, data string) (msg *TaskMessage, admitted bool, err error) {
+	msg, err = unmarshalTaskMessage(data)
+	if err != nil {
+		return nil, false, err
+	}
+	allowed, retryAfter, err := r.takeToken(msg.Type)
+	if err != nil {
+		return nil, false, err
+	}
+	if allowed {
+		return msg, true, nil
+	}
+	if err := r.rescheduleRateLimited(destKey, data, retryAfter); err != nil {
+		return nil, false, err
+	}
+	return nil, false, nil
+}
+
+// rescheduleRateLimited atomically moves data out of destKey (where
+// it was already placed by a dequeue operation) and into the
+// scheduled queue, to be processed again after retryAfter.
+func (r *RDB) rescheduleRateLimited(destKey, data string, retryAfter time.Duration) error {
+	script := redis.NewScript(`
+	redis.call("LREM", KEYS[1], 0, ARGV[1])
+	redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+	return redis.status_reply("OK")
+	`)
+	processAt := time.Now().Add(retryAfter).Unix()
+	return script.Run(r.client,
+		[]string{destKey, scheduledQ}, data, processAt).Err()
+}
+
+// weightedShuffle returns qnames reordered such that queues with
+// higher weights are more likely to appear earlier, while every
+// queue still has a chance to be visited first.
+func weightedShuffle(qnames []string, weights []int) []string {
+	total := 0
+	for _, w := range weights {
+		if w < 1 {
+			w = 1
+		}
+		total += w
+	}
+	remaining := append([]string(nil), qnames...)
+	remainingWeights := make([]int, len(weights))
+	copy(remainingWeights, weights)
+	order := make([]string, 0, len(qnames))
+	for total > 0 && len(remaining) > 0 {
+		pick := rand.Intn(total)
+		for i, w := range remainingWeights {
+			if w < 1 {
+				w = 1
+			}
+			if pick < w {
+				order = append(order, remaining[i])
+				total -= w
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				remainingWeights = append(remainingWeights[:i], remainingWeights[i+1:]...)
+				break
+			}
+			pick -= w
+		}
+	}
+	return order
+}
+
+func unmarshalTaskMessage(data string) (*TaskMessage, error) {
+	var msg TaskMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Done removes the task from in-progress queue to mark the task as
+// done, releasing its uniqueness lock, if any, so an identical task
+// may be enqueued again, and promoting any children enqueued via
+// EnqueueWithDeps whose dependency on this task was the last one
+// blocking them.
+func (r *RDB) Done(msg *TaskMessage) error {
+	return r.done(inProgressQ, msg)
+}
+
+// DoneFromWorker is like Done, but removes the task from workerID's
+// own in-progress list instead of the shared one.
+func (r *RDB) DoneFromWorker(workerID string, msg *TaskMessage) error {
+	return r.done(workerInProgressKey(workerID), msg)
+}
+
+func (r *RDB) done(inProgressKey string, msg *TaskMessage) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := r.client.LRem(inProgressKey, 0, string(bytes)).Err(); err != nil {
+		return err
+	}
+	if err := r.releaseUniqueLock(msg); err != nil {
+		return err
+	}
+	_, err = r.promoteChildren(msg.ID)
+	return err
+}
+
+// Kill sends the task to the "dead" queue from in-progress queue,
+// releasing its uniqueness lock, if any, since the task won't be
+// retried further.
+func (r *RDB) Kill(msg *TaskMessage) error {
+	return r.kill(inProgressQ, msg)
+}
+
+// KillFromWorker is like Kill, but removes the task from workerID's
+// own in-progress list instead of the shared one.
+func (r *RDB) KillFromWorker(workerID string, msg *TaskMessage) error {
+	return r.kill(workerInProgressKey(workerID), msg)
+}
+
+func (r *RDB) kill(inProgressKey string, msg *TaskMessage) error {
+	bytesToRemove, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	script := redis.NewScript(`
+	redis.call("LREM", KEYS[1], 0, ARGV[1])
+	redis.call("ZADD", KEYS[2], ARGV[2], ARGV[1])
+	return redis.status_reply("OK")
+	`)
+	if err := script.Run(r.client,
+		[]string{inProgressKey, deadQ},
+		string(bytesToRemove), time.Now().Unix()).Err(); err != nil {
+		return err
+	}
+	return r.releaseUniqueLock(msg)
+}
+
+// releaseUniqueLock deletes the uniqueness lock for msg's type and
+// payload, if one exists. It does so however msg itself was enqueued,
+// so finishing a task enqueued with plain Enqueue also releases a lock
+// held for an identical task enqueued via EnqueueUnique or
+// ScheduleUnique.
+func (r *RDB) releaseUniqueLock(msg *TaskMessage) error {
+	lockKey, err := uniqueKey(msg.Type, msg.Payload)
+	if err != nil {
+		return err
+	}
+	return r.client.Del(lockKey).Err()
+}
+
+// RestoreUnfinished moves all tasks from the in-progress list back to
+// the queue they were originally enqueued to.
+func (r *RDB) RestoreUnfinished() error {
+	data := r.client.LRange(inProgressQ, 0, -1).Val()
+	for _, s := range data {
+		msg, err := unmarshalTaskMessage(s)
+		if err != nil {
+			return err
+		}
+		script := redis.NewScript(`
+		redis.call("LREM", KEYS[1], 0, ARGV[1])
+		redis.call("RPUSH", KEYS[2], ARGV[1])
+		return redis.status_reply("OK")
+		`)
+		if err := script.Run(r.client,
+			[]string{inProgressQ, queueKey(msg.queueName())}, s).Err(); err != nil {
+			return err
+		}
+		if err := r.registerQueue(msg.queueName()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Heartbeat records that workerID is alive, extending its liveness
+// TTL by ttl. A worker that is using DequeueFromWorker must call this
+// periodically (with a period shorter than ttl); once a worker stops
+// heartbeating, ReclaimExpired treats it as dead and requeues its
+// in-progress tasks.
+func (r *RDB) Heartbeat(workerID string, ttl time.Duration) error {
+	if err := r.client.SAdd(workerSet, workerID).Err(); err != nil {
+		return err
+	}
+	return r.client.Set(workerHeartbeatKey(workerID), 1, ttl).Err()
+}
+
+// ReclaimExpired scans the known workers for ones whose heartbeat has
+// expired and moves any tasks left in their in-progress list back to
+// the queue they were originally enqueued to, atomically per task. It
+// returns the number of tasks reclaimed this way.
+//
+// Unlike RestoreUnfinished, ReclaimExpired only touches workers whose
+// heartbeat is gone, so it's safe to call on a live multi-node
+// cluster without disturbing tasks that healthy workers are still
+// processing.
+func (r *RDB) ReclaimExpired() (int64, error) {
+	workerIDs, err := r.client.SMembers(workerSet).Result()
+	if err != nil {
+		return 0, err
+	}
+	var reclaimed int64
+	for _, id := range workerIDs {
+		alive, err := r.client.Exists(workerHeartbeatKey(id)).Result()
+		if err != nil {
+			return reclaimed, err
+		}
+		if alive != 0 {
+			continue
+		}
+		key := workerInProgressKey(id)
+		data := r.client.LRange(key, 0, -1).Val()
+		for _, s := range data {
+			msg, err := unmarshalTaskMessage(s)
+			if err != nil {
+				return reclaimed, err
+			}
+			script := redis.NewScript(`
+			redis.call("LREM", KEYS[1], 0, ARGV[1])
+			redis.call("RPUSH", KEYS[2], ARGV[1])
+			return redis.status_reply("OK")
+			`)
+			if err := script.Run(r.client,
+				[]string{key, queueKey(msg.queueName())}, s).Err(); err != nil {
+				return reclaimed, err
+			}
+			if err := r.registerQueue(msg.queueName()); err != nil {
+				return reclaimed, err
+			}
+			reclaimed++
+		}
+		if err := r.client.SRem(workerSet, id).Err(); err != nil {
+			return reclaimed, err
+		}
+	}
+	return reclaimed, nil
+}
+
+// Schedule adds the task to the scheduled queue to be processed in the future.
+func (r *RDB) Schedule(msg *TaskMessage, processAt time.Time) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := r.registerQueue(msg.queueName()); err != nil {
+		return err
+	}
+	return r.client.ZAdd(scheduledQ,
+		&redis.Z{Member: string(bytes), Score: float64(processAt.Unix())}).Err()
+}
+
+// ScheduleUnique adds the task to the scheduled queue to be processed
+// at processAt, unless a task with the same type and payload is
+// already enqueued, scheduled, or in-progress, in which case it
+// returns ErrDuplicateTask. The uniqueness lock expires after ttl.
+func (r *RDB) ScheduleUnique(msg *TaskMessage, processAt time.Time, ttl time.Duration) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	lockKey, err := uniqueKey(msg.Type, msg.Payload)
+	if err != nil {
+		return err
+	}
+	if err := r.registerQueue(msg.queueName()); err != nil {
+		return err
+	}
+	// KEYS[1] -> unique lock key
+	// KEYS[2] -> asynq:scheduled
+	// ARGV[1] -> task message value
+	// ARGV[2] -> lock TTL in milliseconds
+	// ARGV[3] -> process_at UNIX timestamp (score)
+	script := redis.NewScript(`
+	local ok = redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+	if not ok then
+		return 0
+	end
+	redis.call("ZADD", KEYS[2], ARGV[3], ARGV[1])
+	return 1
+	`)
+	res, err := script.Run(r.client,
+		[]string{lockKey, scheduledQ},
+		string(bytes), ttl.Milliseconds(), processAt.Unix()).Result()
+	if err != nil {
+		return err
+	}
+	if n, ok := res.(int64); ok && n == 0 {
+		return ErrDuplicateTask
+	}
+	return nil
+}
+
+// RetryLater moves the task to the retry queue to be processed again at processAt.
+func (r *RDB) RetryLater(msg *TaskMessage, processAt time.Time) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := r.registerQueue(msg.queueName()); err != nil {
+		return err
+	}
+	return r.client.ZAdd(retryQ,
+		&redis.Z{Member: string(bytes), Score: float64(processAt.Unix())}).Err()
+}
+
+// CheckAndEnqueue checks for all scheduled and retry tasks and
+// enqueues any tasks that are ready to be processed.
+func (r *RDB) CheckAndEnqueue() error {
+	for _, zset := range []string{scheduledQ, retryQ} {
+		if err := r.forward(zset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forward moves all tasks with a score less than or equal to the
+// current unix time from the given zset to their destination queue.
+func (r *RDB) forward(from string) error {
+	now := time.Now()
+	data := r.client.ZRangeByScore(from, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now.Unix()),
+	}).Val()
+	for _, s := range data {
+		msg, err := unmarshalTaskMessage(s)
+		if err != nil {
+			return err
+		}
+		script := redis.NewScript(`
+		redis.call("ZREM", KEYS[1], ARGV[1])
+		redis.call("LPUSH", KEYS[2], ARGV[1])
+		return redis.status_reply("OK")
+		`)
+		if err := script.Run(r.client,
+			[]string{from, queueKey(msg.queueName())}, s).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package rdb
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/google/go-cmp/cmp"
+	"github.com/rs/xid"
+)
+
+// TODO(hibiken): Get Redis address and db number from ENV variables.
+func setup(t *testing.T) *RDB {
+	t.Helper()
+	r := NewRDB(redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+		DB:   13,
+	}))
+	flushDB(t, r)
+	return r
+}
+
+func flushDB(t *testing.T, r *RDB) {
+	t.Helper()
+	if err := r.client.FlushDB().Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sortedSetEntry represents an entry in a redis sorted set, pairing a
+// task message with the score it was seeded with.
+type sortedSetEntry struct {
+	msg   *TaskMessage
+	score int64
+}
+
+// sortMsgOpt is a cmp.Option to sort []*TaskMessage for comparison,
+// since queue operations don't guarantee ordering across entries with
+// equal content.
+var sortMsgOpt = cmp.Transformer("SortTaskMessages", func(in []*TaskMessage) []*TaskMessage {
+	out := append([]*TaskMessage(nil), in...)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+})
+
+func newTaskMessage(taskType string, payload map[string]interface{}) *TaskMessage {
+	return &TaskMessage{
+		ID:      xid.New().String(),
+		Type:    taskType,
+		Queue:   "default",
+		Retry:   25,
+		Payload: payload,
+	}
+}
+
+func mustUnmarshal(t *testing.T, data string) *TaskMessage {
+	t.Helper()
+	var msg TaskMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatal(err)
+	}
+	return &msg
+}
+
+func mustUnmarshalSlice(t *testing.T, data []string) []*TaskMessage {
+	t.Helper()
+	var msgs []*TaskMessage
+	for _, s := range data {
+		msgs = append(msgs, mustUnmarshal(t, s))
+	}
+	return msgs
+}
+
+func seedRedisList(t *testing.T, r *RDB, key string, msgs []*TaskMessage) {
+	t.Helper()
+	for _, msg := range msgs {
+		bytes, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.client.LPush(key, string(bytes)).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func seedRedisZSet(t *testing.T, r *RDB, key string, entries []sortedSetEntry) {
+	t.Helper()
+	for _, e := range entries {
+		bytes, err := json.Marshal(e.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z := &redis.Z{Member: string(bytes), Score: float64(e.score)}
+		if err := r.client.ZAdd(key, z).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func seedDefaultQueue(t *testing.T, r *RDB, msgs []*TaskMessage) {
+	t.Helper()
+	seedRedisList(t, r, defaultQ, msgs)
+}
+
+func seedInProgressQueue(t *testing.T, r *RDB, msgs []*TaskMessage) {
+	t.Helper()
+	seedRedisList(t, r, inProgressQ, msgs)
+}
+
+func seedDeadQueue(t *testing.T, r *RDB, entries []sortedSetEntry) {
+	t.Helper()
+	seedRedisZSet(t, r, deadQ, entries)
+}
+
+func seedScheduledQueue(t *testing.T, r *RDB, entries []sortedSetEntry) {
+	t.Helper()
+	seedRedisZSet(t, r, scheduledQ, entries)
+}
+
+func seedRetryQueue(t *testing.T, r *RDB, entries []sortedSetEntry) {
+	t.Helper()
+	seedRedisZSet(t, r, retryQ, entries)
+}
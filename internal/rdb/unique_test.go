@@ -0,0 +1,105 @@
+package rdb
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnqueueUnique(t *testing.T) {
+	r := setup(t)
+	t1 := newTaskMessage("email", map[string]interface{}{"to": "user@example.com"})
+	t2 := newTaskMessage("email", map[string]interface{}{"to": "user@example.com"})
+
+	flushDB(t, r)
+
+	if err := r.EnqueueUnique(t1, time.Minute); err != nil {
+		t.Fatalf("first EnqueueUnique(t1) = %v, want nil", err)
+	}
+	if err := r.EnqueueUnique(t2, time.Minute); err != ErrDuplicateTask {
+		t.Errorf("second EnqueueUnique(t2) = %v, want %v", err, ErrDuplicateTask)
+	}
+
+	res := r.client.LRange(defaultQ, 0, -1).Val()
+	if len(res) != 1 {
+		t.Errorf("%q has length %d, want 1", defaultQ, len(res))
+	}
+}
+
+func TestEnqueueUniqueConcurrent(t *testing.T) {
+	r := setup(t)
+	flushDB(t, r)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg := newTaskMessage("reindex", map[string]interface{}{"shard": 1})
+			errs[i] = r.EnqueueUnique(msg, time.Minute)
+		}(i)
+	}
+	wg.Wait()
+
+	var successes int
+	for _, err := range errs {
+		if err == nil {
+			successes++
+		} else if err != ErrDuplicateTask {
+			t.Errorf("EnqueueUnique returned unexpected error: %v", err)
+		}
+	}
+	if successes != 1 {
+		t.Errorf("got %d successful enqueues out of %d concurrent calls, want 1", successes, n)
+	}
+
+	res := r.client.LRange(defaultQ, 0, -1).Val()
+	if len(res) != 1 {
+		t.Errorf("%q has length %d, want 1", defaultQ, len(res))
+	}
+}
+
+func TestEnqueueUniqueReleasedOnDone(t *testing.T) {
+	r := setup(t)
+	flushDB(t, r)
+
+	msg := newTaskMessage("email", map[string]interface{}{"to": "user@example.com"})
+	if err := r.EnqueueUnique(msg, time.Minute); err != nil {
+		t.Fatalf("EnqueueUnique = %v, want nil", err)
+	}
+	got, err := r.Dequeue(time.Second)
+	if err != nil {
+		t.Fatalf("Dequeue = %v, want nil", err)
+	}
+	if err := r.Done(got); err != nil {
+		t.Fatalf("Done = %v, want nil", err)
+	}
+
+	dup := newTaskMessage("email", map[string]interface{}{"to": "user@example.com"})
+	if err := r.EnqueueUnique(dup, time.Minute); err != nil {
+		t.Errorf("EnqueueUnique after Done = %v, want nil", err)
+	}
+}
+
+func TestScheduleUnique(t *testing.T) {
+	r := setup(t)
+	flushDB(t, r)
+
+	processAt := time.Now().Add(15 * time.Minute)
+	t1 := newTaskMessage("email", map[string]interface{}{"to": "user@example.com"})
+	t2 := newTaskMessage("email", map[string]interface{}{"to": "user@example.com"})
+
+	if err := r.ScheduleUnique(t1, processAt, time.Minute); err != nil {
+		t.Fatalf("first ScheduleUnique(t1) = %v, want nil", err)
+	}
+	if err := r.ScheduleUnique(t2, processAt, time.Minute); err != ErrDuplicateTask {
+		t.Errorf("second ScheduleUnique(t2) = %v, want %v", err, ErrDuplicateTask)
+	}
+
+	res := r.client.ZRange(scheduledQ, 0, -1).Val()
+	if len(res) != 1 {
+		t.Errorf("%q has length %d, want 1", scheduledQ, len(res))
+	}
+}